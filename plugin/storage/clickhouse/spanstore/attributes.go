@@ -0,0 +1,139 @@
+package spanstore
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AttributeScope identifies whether an AttributePredicate targets span-level
+// tags or process/resource-level tags.
+type AttributeScope string
+
+const (
+	ScopeSpanTag     AttributeScope = "span"
+	ScopeResourceTag AttributeScope = "resource"
+)
+
+// AttributeOperator identifies the comparison applied by an AttributePredicate.
+type AttributeOperator string
+
+const (
+	OpEqual        AttributeOperator = "="
+	OpNotEqual     AttributeOperator = "!="
+	OpGreaterEqual AttributeOperator = ">="
+	OpLessEqual    AttributeOperator = "<="
+	OpGreaterThan  AttributeOperator = ">"
+	OpLessThan     AttributeOperator = "<"
+	OpContains     AttributeOperator = "contains"
+	OpRegex        AttributeOperator = "regex"
+	OpIn           AttributeOperator = "in"
+	OpExists       AttributeOperator = "exists"
+)
+
+// AttributePredicate is a single typed comparison against a span or resource
+// attribute, e.g. {Scope: ScopeSpanTag, Key: "http.status_code", Operator: OpGreaterEqual, Value: int64(500)}.
+type AttributePredicate struct {
+	Scope    AttributeScope
+	Key      string
+	Operator AttributeOperator
+	Value    interface{}
+}
+
+// AttributeQuery is a set of typed attribute/resource predicates that are
+// ANDed together in addition to the plain equality tags already supported by
+// TraceQueryParameters.Tags. It lets callers express the numeric, regex and
+// "contains" predicates that a string-only has(tags, 'k=v') check cannot.
+type AttributeQuery struct {
+	Predicates []AttributePredicate
+}
+
+// attributeColumn returns the Map(String, T) column that stores values of the
+// predicate's type for the given scope, e.g. tags_string, resource_int64.
+// This mirrors the indexTable schema, which splits attributes by scope and
+// value type instead of stringifying everything into a single `tags` array.
+func attributeColumn(scope AttributeScope, value interface{}) (string, error) {
+	prefix := "tags"
+	if scope == ScopeResourceTag {
+		prefix = "resource"
+	}
+
+	switch value.(type) {
+	case string:
+		return prefix + "_string", nil
+	case int, int64:
+		return prefix + "_int64", nil
+	case float64, float32:
+		return prefix + "_float64", nil
+	case bool:
+		return prefix + "_bool", nil
+	default:
+		return "", fmt.Errorf("unsupported attribute value type %T", value)
+	}
+}
+
+// buildAttributePredicate renders a single AttributePredicate into a
+// ClickHouse WHERE clause fragment over the Map-typed tag columns, along with
+// its bound arguments, in the order they appear in the fragment.
+func buildAttributePredicate(p AttributePredicate) (string, []interface{}, error) {
+	prefix := "tags"
+	if p.Scope == ScopeResourceTag {
+		prefix = "resource"
+	}
+
+	// OpExists has no typed value to resolve a single column from: the key
+	// may have been written under any of the four Map columns, so check all.
+	if p.Operator == OpExists {
+		return fmt.Sprintf(
+			"(mapContains(%s_string, ?) OR mapContains(%s_int64, ?) OR mapContains(%s_float64, ?) OR mapContains(%s_bool, ?))",
+			prefix, prefix, prefix, prefix,
+		), []interface{}{p.Key, p.Key, p.Key, p.Key}, nil
+	}
+
+	if p.Operator == OpIn {
+		values, ok := p.Value.([]interface{})
+		if !ok || len(values) == 0 {
+			return "", nil, fmt.Errorf("attribute predicate for key %q: \"in\" requires a non-empty list value", p.Key)
+		}
+
+		column, err := attributeColumn(p.Scope, values[0])
+		if err != nil {
+			return "", nil, fmt.Errorf("attribute predicate for key %q: %w", p.Key, err)
+		}
+
+		exists := fmt.Sprintf("mapContains(%s, ?)", column)
+		lookup := fmt.Sprintf("%s[?]", column)
+		placeholders := "?" + strings.Repeat(",?", len(values)-1)
+
+		args := append([]interface{}{p.Key, p.Key}, values...)
+		return fmt.Sprintf("(%s AND %s IN (%s))", exists, lookup, placeholders), args, nil
+	}
+
+	column, err := attributeColumn(p.Scope, p.Value)
+	if err != nil {
+		return "", nil, fmt.Errorf("attribute predicate for key %q: %w", p.Key, err)
+	}
+
+	exists := fmt.Sprintf("mapContains(%s, ?)", column)
+	lookup := fmt.Sprintf("%s[?]", column)
+
+	switch p.Operator {
+	case OpEqual:
+		return fmt.Sprintf("(%s AND %s = ?)", exists, lookup), []interface{}{p.Key, p.Key, p.Value}, nil
+	case OpNotEqual:
+		return fmt.Sprintf("(NOT %s OR %s != ?)", exists, lookup), []interface{}{p.Key, p.Key, p.Value}, nil
+	case OpGreaterEqual:
+		return fmt.Sprintf("(%s AND %s >= ?)", exists, lookup), []interface{}{p.Key, p.Key, p.Value}, nil
+	case OpLessEqual:
+		return fmt.Sprintf("(%s AND %s <= ?)", exists, lookup), []interface{}{p.Key, p.Key, p.Value}, nil
+	case OpGreaterThan:
+		return fmt.Sprintf("(%s AND %s > ?)", exists, lookup), []interface{}{p.Key, p.Key, p.Value}, nil
+	case OpLessThan:
+		return fmt.Sprintf("(%s AND %s < ?)", exists, lookup), []interface{}{p.Key, p.Key, p.Value}, nil
+	case OpContains:
+		return fmt.Sprintf("(%s AND position(%s, ?) > 0)", exists, lookup), []interface{}{p.Key, p.Key, p.Value}, nil
+	case OpRegex:
+		return fmt.Sprintf("(%s AND match(%s, ?))", exists, lookup), []interface{}{p.Key, p.Key, p.Value}, nil
+	default:
+		return "", nil, fmt.Errorf("attribute predicate for key %q: unsupported operator %q", p.Key, p.Operator)
+	}
+}
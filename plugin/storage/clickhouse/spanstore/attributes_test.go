@@ -0,0 +1,98 @@
+package spanstore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttributeColumn(t *testing.T) {
+	tests := []struct {
+		name   string
+		scope  AttributeScope
+		value  interface{}
+		column string
+	}{
+		{"span string", ScopeSpanTag, "v", "tags_string"},
+		{"span int64", ScopeSpanTag, int64(1), "tags_int64"},
+		{"span int", ScopeSpanTag, 1, "tags_int64"},
+		{"span float64", ScopeSpanTag, 1.5, "tags_float64"},
+		{"span bool", ScopeSpanTag, true, "tags_bool"},
+		{"resource string", ScopeResourceTag, "v", "resource_string"},
+		{"resource int64", ScopeResourceTag, int64(1), "resource_int64"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			column, err := attributeColumn(tt.scope, tt.value)
+			require.NoError(t, err)
+			assert.Equal(t, tt.column, column)
+		})
+	}
+
+	_, err := attributeColumn(ScopeSpanTag, []byte("x"))
+	assert.Error(t, err)
+}
+
+func TestBuildAttributePredicate_Equal(t *testing.T) {
+	sql, args, err := buildAttributePredicate(AttributePredicate{
+		Scope: ScopeSpanTag, Key: "http.status_code", Operator: OpEqual, Value: int64(500),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "(mapContains(tags_int64, ?) AND tags_int64[?] = ?)", sql)
+	assert.Equal(t, []interface{}{"http.status_code", "http.status_code", int64(500)}, args)
+}
+
+func TestBuildAttributePredicate_GreaterLessStrict(t *testing.T) {
+	gt, args, err := buildAttributePredicate(AttributePredicate{
+		Scope: ScopeSpanTag, Key: "http.status_code", Operator: OpGreaterThan, Value: int64(500),
+	})
+	require.NoError(t, err)
+	assert.Contains(t, gt, "> ?")
+	assert.NotContains(t, gt, ">= ?")
+	assert.Equal(t, []interface{}{"http.status_code", "http.status_code", int64(500)}, args)
+
+	lt, _, err := buildAttributePredicate(AttributePredicate{
+		Scope: ScopeSpanTag, Key: "http.status_code", Operator: OpLessThan, Value: int64(500),
+	})
+	require.NoError(t, err)
+	assert.Contains(t, lt, "< ?")
+	assert.NotContains(t, lt, "<= ?")
+}
+
+func TestBuildAttributePredicate_Exists(t *testing.T) {
+	sql, args, err := buildAttributePredicate(AttributePredicate{
+		Scope: ScopeResourceTag, Key: "k8s.pod", Operator: OpExists,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "(mapContains(resource_string, ?) OR mapContains(resource_int64, ?) OR mapContains(resource_float64, ?) OR mapContains(resource_bool, ?))", sql)
+	assert.Equal(t, []interface{}{"k8s.pod", "k8s.pod", "k8s.pod", "k8s.pod"}, args)
+}
+
+func TestBuildAttributePredicate_In(t *testing.T) {
+	sql, args, err := buildAttributePredicate(AttributePredicate{
+		Scope: ScopeSpanTag, Key: "http.status_code", Operator: OpIn,
+		Value: []interface{}{int64(500), int64(502)},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "(mapContains(tags_int64, ?) AND tags_int64[?] IN (?,?))", sql)
+	assert.Equal(t, []interface{}{"http.status_code", "http.status_code", int64(500), int64(502)}, args)
+
+	_, _, err = buildAttributePredicate(AttributePredicate{
+		Scope: ScopeSpanTag, Key: "k", Operator: OpIn, Value: []interface{}{},
+	})
+	assert.Error(t, err)
+
+	_, _, err = buildAttributePredicate(AttributePredicate{
+		Scope: ScopeSpanTag, Key: "k", Operator: OpIn, Value: "not-a-list",
+	})
+	assert.Error(t, err)
+}
+
+func TestBuildAttributePredicate_UnsupportedOperator(t *testing.T) {
+	_, _, err := buildAttributePredicate(AttributePredicate{
+		Scope: ScopeSpanTag, Key: "k", Operator: "bogus", Value: "v",
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,45 @@
+package spanstore
+
+import (
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// PoolConfig configures the native ClickHouse connection pool backing a
+// TraceReader: how many connections it keeps warm, how long it keeps them,
+// and how long a single statement is allowed to run before its context is
+// canceled.
+type PoolConfig struct {
+	MinConns        int
+	MaxConns        int
+	MaxConnLifetime time.Duration
+	ReadTimeout     time.Duration
+}
+
+// DefaultPoolConfig returns the pool settings TraceReader falls back to when
+// none are supplied.
+func DefaultPoolConfig() PoolConfig {
+	return PoolConfig{
+		MinConns:        2,
+		MaxConns:        10,
+		MaxConnLifetime: time.Hour,
+		ReadTimeout:     30 * time.Second,
+	}
+}
+
+// OpenPool dials a native ClickHouse connection pool against addr, reusing
+// connections across queries and caching prepared statements by query shape
+// as provided by the clickhouse-go/v2 driver itself.
+func OpenPool(addr []string, auth clickhouse.Auth, cfg PoolConfig) (driver.Conn, error) {
+	return clickhouse.Open(&clickhouse.Options{
+		Addr:            addr,
+		Auth:            auth,
+		DialTimeout:     5 * time.Second,
+		MaxOpenConns:    cfg.MaxConns,
+		MaxIdleConns:    cfg.MinConns,
+		ConnMaxLifetime: cfg.MaxConnLifetime,
+		ReadTimeout:     cfg.ReadTimeout,
+	})
+}
@@ -0,0 +1,118 @@
+package spanstore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+)
+
+// TraceQualityFilter adds "interesting trace" predicates to FindTraceIDs
+// without requiring the caller to know which tags to search for: errors,
+// unusually large traces, or traces slower than their peers. It is evaluated
+// against summaryTable, which the writer fills beside indexTable with one row
+// per span (service, operation, error flag, duration); span count, service
+// count and error flag are aggregated per trace at query time.
+type TraceQualityFilter struct {
+	HasError        bool
+	MinSpanCount    int
+	MinServiceCount int
+	// LatencyPercentile, when set (e.g. 0.95), restricts results to traces
+	// with a span of the service whose duration is at or above that
+	// percentile of span durations recorded for the same service (and
+	// operation, when set) in summaryTable.
+	LatencyPercentile float64
+}
+
+// FindTraceIDsWithQuality retrieves TraceIDs matching the plain
+// TraceQueryParameters filters plus a TraceQualityFilter, making searches
+// like "slow, erroring checkout traces in the last hour" a simple WHERE
+// clause instead of a client-side post-filter.
+func (r *TraceReader) FindTraceIDsWithQuality(ctx context.Context, params *spanstore.TraceQueryParameters, quality *TraceQualityFilter) ([]model.TraceID, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "FindTraceIDsWithQuality")
+	defer span.Finish()
+
+	if r.indexTable == "" {
+		return nil, ErrNoIndexTable
+	}
+	if r.summaryTable == "" {
+		return nil, ErrNoSummaryTable
+	}
+	if quality == nil {
+		return nil, fmt.Errorf("quality filter is required")
+	}
+	if quality.LatencyPercentile < 0 || quality.LatencyPercentile >= 1 {
+		return nil, fmt.Errorf("quality.LatencyPercentile must be in [0, 1), got %v", quality.LatencyPercentile)
+	}
+
+	query, args, err := r.buildTraceIDsQuery(params)
+	if err != nil {
+		return nil, err
+	}
+
+	subquery, subargs := r.buildQualitySubquery(params, quality)
+	query = query + " AND traceID IN (" + subquery + ")"
+	args = append(args, subargs...)
+
+	// Sorting by service is required for early termination of primary key scan:
+	// * https://github.com/ClickHouse/ClickHouse/issues/7102
+	query = query + " ORDER BY service DESC, timestamp DESC LIMIT ?"
+	args = append(args, params.NumTraces)
+
+	span.SetTag("db.statement", query)
+	span.SetTag("db.args", args)
+
+	return r.queryTraceIDs(ctx, query, args...)
+}
+
+// buildQualitySubquery renders the summaryTable subquery that
+// FindTraceIDsWithQuality intersects against indexTable. summaryTable (see
+// schema.sql) holds one row per span, so spanCount/serviceCount/hasError are
+// aggregated per traceID here rather than read as pre-summed columns.
+func (r *TraceReader) buildQualitySubquery(params *spanstore.TraceQueryParameters, quality *TraceQualityFilter) (string, []interface{}) {
+	candidates := fmt.Sprintf("SELECT traceID FROM %s WHERE service = ?", r.summaryTable)
+	args := []interface{}{params.ServiceName}
+
+	if quality.LatencyPercentile > 0 {
+		percentileQuery := fmt.Sprintf("SELECT quantile(?)(durationUs) FROM %s WHERE service = ?", r.summaryTable)
+		percentileArgs := []interface{}{quality.LatencyPercentile, params.ServiceName}
+
+		if params.OperationName != "" {
+			percentileQuery = percentileQuery + " AND operation = ?"
+			percentileArgs = append(percentileArgs, params.OperationName)
+		}
+
+		candidates = candidates + " AND durationUs >= (" + percentileQuery + ")"
+		args = append(args, percentileArgs...)
+	}
+
+	// Candidates are picked by their spans of the service, but the HAVING
+	// aggregates below run over every span of each candidate trace.
+	query := fmt.Sprintf("SELECT traceID FROM %s WHERE traceID IN (%s) GROUP BY traceID", r.summaryTable, candidates)
+
+	having := []string{}
+
+	if quality.HasError {
+		having = append(having, "max(hasError) = 1")
+	}
+
+	if quality.MinSpanCount > 0 {
+		having = append(having, "count() >= ?")
+		args = append(args, quality.MinSpanCount)
+	}
+
+	if quality.MinServiceCount > 0 {
+		having = append(having, "uniqExact(service) >= ?")
+		args = append(args, quality.MinServiceCount)
+	}
+
+	if len(having) > 0 {
+		query = query + " HAVING " + strings.Join(having, " AND ")
+	}
+
+	return query, args
+}
@@ -0,0 +1,57 @@
+package spanstore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+)
+
+func TestBuildQualitySubquery_HavingClauses(t *testing.T) {
+	r := NewTraceReader(nil, "operations", "index", "spans", "summary", 0)
+	params := &spanstore.TraceQueryParameters{ServiceName: "checkout"}
+
+	sql, args := r.buildQualitySubquery(params, &TraceQualityFilter{
+		HasError:        true,
+		MinSpanCount:    5,
+		MinServiceCount: 2,
+	})
+
+	assert.Contains(t, sql, "GROUP BY traceID")
+	assert.Contains(t, sql, "HAVING max(hasError) = 1 AND count() >= ? AND uniqExact(service) >= ?")
+	assert.Equal(t, []interface{}{"checkout", 5, 2}, args)
+}
+
+func TestBuildQualitySubquery_LatencyPercentileBindsOperationFilter(t *testing.T) {
+	r := NewTraceReader(nil, "operations", "index", "spans", "summary", 0)
+	params := &spanstore.TraceQueryParameters{ServiceName: "checkout", OperationName: "POST /cart"}
+
+	sql, args := r.buildQualitySubquery(params, &TraceQualityFilter{LatencyPercentile: 0.95})
+
+	assert.Contains(t, sql, "durationUs >= (SELECT quantile(?)(durationUs) FROM summary WHERE service = ? AND operation = ?)")
+	assert.Equal(t, []interface{}{"checkout", 0.95, "checkout", "POST /cart"}, args)
+}
+
+func TestFindTraceIDsWithQuality_NilFilterIsRejected(t *testing.T) {
+	r := NewTraceReader(nil, "operations", "index", "spans", "summary", 0)
+
+	_, err := r.FindTraceIDsWithQuality(context.Background(), &spanstore.TraceQueryParameters{ServiceName: "checkout"}, nil)
+	require.Error(t, err)
+}
+
+func TestFindTraceIDsWithQuality_RejectsOutOfRangePercentile(t *testing.T) {
+	r := NewTraceReader(nil, "operations", "index", "spans", "summary", 0)
+
+	_, err := r.FindTraceIDsWithQuality(context.Background(),
+		&spanstore.TraceQueryParameters{ServiceName: "checkout"},
+		&TraceQualityFilter{LatencyPercentile: 1.5})
+	assert.Error(t, err)
+
+	_, err = r.FindTraceIDsWithQuality(context.Background(),
+		&spanstore.TraceQueryParameters{ServiceName: "checkout"},
+		&TraceQualityFilter{LatencyPercentile: -0.1})
+	assert.Error(t, err)
+}
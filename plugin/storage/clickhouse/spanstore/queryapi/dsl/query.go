@@ -0,0 +1,108 @@
+// Package dsl defines the stable, storage-agnostic query schema accepted by
+// the queryapi subsystem. A Query is a structured alternative to hand-built
+// TraceQueryParameters: it supports boolean composition (AND/OR/NOT) over
+// typed predicates against span tags, process tags and well-known fields, so
+// external tools can describe arbitrary trace searches as JSON instead of
+// the module hand-writing SQL fragments per use case.
+package dsl
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultLimit is the row cap CompileQuery applies when Query.Limit is unset.
+const DefaultLimit = 20
+
+// Operator identifies the comparison applied by a Predicate.
+type Operator string
+
+const (
+	OpEqual    Operator = "eq"
+	OpNotEqual Operator = "ne"
+	OpGreater  Operator = "gt"
+	OpLess     Operator = "lt"
+	OpIn       Operator = "in"
+	OpRegex    Operator = "regex"
+	OpExists   Operator = "exists"
+)
+
+// Well-known Predicate.Field values. Tag and process-tag fields are
+// referenced as "tags.<key>" and "process.tags.<key>" respectively.
+const (
+	FieldDuration  = "duration"
+	FieldStartTime = "startTime"
+	FieldService   = "service"
+	FieldOperation = "operation"
+)
+
+// Predicate is a single typed comparison against a field, e.g.
+// {Field: "tags.http.status_code", Operator: OpGreater, Value: 500}.
+type Predicate struct {
+	Field    string      `json:"field"`
+	Operator Operator    `json:"operator"`
+	Value    interface{} `json:"value,omitempty"`
+}
+
+// Expr is a boolean expression tree over Predicates. Exactly one of
+// Predicate, And, Or or Not should be set.
+type Expr struct {
+	Predicate *Predicate `json:"predicate,omitempty"`
+	And       []*Expr    `json:"and,omitempty"`
+	Or        []*Expr    `json:"or,omitempty"`
+	Not       *Expr      `json:"not,omitempty"`
+}
+
+// SortField describes one term of a Query's ORDER BY.
+type SortField struct {
+	Field string `json:"field"`
+	Desc  bool   `json:"desc,omitempty"`
+}
+
+// Query is the top-level structured search request. StartTimeMin/Max and
+// DurationMin/Max mirror spanstore.TraceQueryParameters; Where carries
+// anything beyond what that flat struct can express.
+type Query struct {
+	Service      string        `json:"service"`
+	Operation    string        `json:"operation,omitempty"`
+	StartTimeMin time.Time     `json:"startTimeMin,omitempty"`
+	StartTimeMax time.Time     `json:"startTimeMax,omitempty"`
+	DurationMin  time.Duration `json:"durationMin,omitempty"`
+	DurationMax  time.Duration `json:"durationMax,omitempty"`
+	Where        *Expr         `json:"where,omitempty"`
+	Sort         []SortField   `json:"sort,omitempty"`
+	Limit        int           `json:"limit,omitempty"`
+	Cursor       string        `json:"cursor,omitempty"`
+}
+
+// EncodeCursor builds the opaque pagination token for Query.Cursor from the
+// last (startTime, traceID) row a client has seen, sorted by startTime
+// descending - the default CompileQuery order. Passing the result back as
+// the next request's Cursor resumes the scan right after that row.
+func EncodeCursor(lastStartTime time.Time, lastTraceID string) string {
+	raw := fmt.Sprintf("%d:%s", lastStartTime.UnixNano(), lastTraceID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor reverses EncodeCursor.
+func DecodeCursor(cursor string) (lastStartTime time.Time, lastTraceID string, err error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return time.Time{}, "", fmt.Errorf("invalid cursor")
+	}
+
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	return time.Unix(0, nanos), parts[1], nil
+}
@@ -0,0 +1,160 @@
+// Package queryapi exposes the dsl query schema as an HTTP endpoint that
+// compiles a posted dsl.Query to ClickHouse SQL via TraceReader and returns
+// the matching traces, so external tools can search traces without the
+// module hand-writing SQL fragments for every use case.
+package queryapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/plugin/storage/clickhouse/spanstore"
+	"github.com/jaegertracing/jaeger/plugin/storage/clickhouse/spanstore/queryapi/dsl"
+	jspanstore "github.com/jaegertracing/jaeger/storage/spanstore"
+)
+
+// Handler serves the structured query DSL endpoint on top of a TraceReader.
+type Handler struct {
+	reader *spanstore.TraceReader
+}
+
+// NewHandler returns a Handler that compiles and runs queries against reader.
+func NewHandler(reader *spanstore.TraceReader) *Handler {
+	return &Handler{reader: reader}
+}
+
+type findTracesResponse struct {
+	Data []*model.Trace `json:"data"`
+	// NextCursor, when set, can be passed back as Query.Cursor to continue
+	// the scan where this page left off.
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// traceLowerBound returns the (startTime, traceID) of trace's earliest span,
+// the anchor CompileQuery's cursor comparison resumes after.
+func traceLowerBound(trace *model.Trace) (time.Time, string) {
+	var earliest time.Time
+	var traceID string
+
+	for _, span := range trace.Spans {
+		if earliest.IsZero() || span.StartTime.Before(earliest) {
+			earliest = span.StartTime
+			traceID = span.TraceID.String()
+		}
+	}
+
+	return earliest, traceID
+}
+
+// RegisterRoutes mounts the handler's endpoints on mux, e.g. when wiring up
+// the query-service's HTTP server.
+func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v3/query", h.find)
+	mux.HandleFunc("/api/v3/query/explain", h.explain)
+}
+
+func (h *Handler) find(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var query dsl.Query
+	if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+		http.Error(w, "invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if query.Service == "" {
+		http.Error(w, "query.service is required", http.StatusBadRequest)
+		return
+	}
+
+	traces, err := h.reader.FindTracesByQuery(r.Context(), query)
+	if err != nil {
+		var invalid *spanstore.InvalidQueryError
+		if errors.As(err, &invalid) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := findTracesResponse{Data: traces}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = dsl.DefaultLimit
+	}
+
+	if len(traces) >= limit {
+		lastStartTime, lastTraceID := traceLowerBound(traces[len(traces)-1])
+		if !lastStartTime.IsZero() {
+			resp.NextCursor = dsl.EncodeCursor(lastStartTime, lastTraceID)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// explainRequest mirrors the subset of spanstore.TraceQueryParameters that
+// ExplainFindTraces' index scan stage reads.
+type explainRequest struct {
+	Service      string        `json:"service"`
+	Operation    string        `json:"operation,omitempty"`
+	StartTimeMin time.Time     `json:"startTimeMin,omitempty"`
+	StartTimeMax time.Time     `json:"startTimeMax,omitempty"`
+	DurationMin  time.Duration `json:"durationMin,omitempty"`
+	DurationMax  time.Duration `json:"durationMax,omitempty"`
+	NumTraces    int           `json:"numTraces,omitempty"`
+}
+
+func (h *Handler) explain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req explainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Service == "" {
+		http.Error(w, "service is required", http.StatusBadRequest)
+		return
+	}
+
+	if req.NumTraces <= 0 {
+		req.NumTraces = 20
+	}
+
+	params := &jspanstore.TraceQueryParameters{
+		ServiceName:   req.Service,
+		OperationName: req.Operation,
+		StartTimeMin:  req.StartTimeMin,
+		StartTimeMax:  req.StartTimeMax,
+		DurationMin:   req.DurationMin,
+		DurationMax:   req.DurationMax,
+		NumTraces:     req.NumTraces,
+	}
+
+	plan, err := h.reader.ExplainFindTraces(r.Context(), params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(plan); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,294 @@
+package spanstore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/plugin/storage/clickhouse/spanstore/queryapi/dsl"
+)
+
+// dslFieldColumn maps a dsl.Query field reference to the indexTable column
+// (and, for tag/process.tag fields, the Map column plus lookup key) it reads
+// from. Tag values are resolved against the typed Map columns introduced for
+// AttributePredicate, so a dsl.Predicate gets the same numeric/regex support.
+//
+// field is attacker-controlled JSON from the /api/v3/query endpoint and the
+// returned column is spliced verbatim into SQL as an identifier (bound
+// parameters only cover values), so any field that doesn't resolve to one of
+// the fixed columns below or a tags./process.tags. prefix is rejected instead
+// of being passed through.
+func dslFieldColumn(field string) (column string, key string, isTag bool, resource bool, err error) {
+	switch {
+	case strings.HasPrefix(field, "process.tags."):
+		key = strings.TrimPrefix(field, "process.tags.")
+		if key == "" {
+			return "", "", false, false, fmt.Errorf("field %q: missing tag key", field)
+		}
+		return "resource", key, true, true, nil
+	case strings.HasPrefix(field, "tags."):
+		key = strings.TrimPrefix(field, "tags.")
+		if key == "" {
+			return "", "", false, false, fmt.Errorf("field %q: missing tag key", field)
+		}
+		return "tags", key, true, false, nil
+	case field == dsl.FieldDuration:
+		return "durationUs", "", false, false, nil
+	case field == dsl.FieldStartTime:
+		return "timestamp", "", false, false, nil
+	case field == dsl.FieldService:
+		return "service", "", false, false, nil
+	case field == dsl.FieldOperation:
+		return "operation", "", false, false, nil
+	default:
+		return "", "", false, false, fmt.Errorf("unknown query field %q", field)
+	}
+}
+
+// compilePredicate renders a single dsl.Predicate into a SQL fragment and its
+// bound arguments.
+func compilePredicate(p *dsl.Predicate) (string, []interface{}, error) {
+	column, key, isTag, resource, err := dslFieldColumn(p.Field)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if isTag {
+		scope := ScopeSpanTag
+		if resource {
+			scope = ScopeResourceTag
+		}
+
+		attrOp, err := dslOperatorToAttribute(p.Operator)
+		if err != nil {
+			return "", nil, fmt.Errorf("field %q: %w", p.Field, err)
+		}
+
+		return buildAttributePredicate(AttributePredicate{Scope: scope, Key: key, Operator: attrOp, Value: p.Value})
+	}
+
+	switch p.Operator {
+	case dsl.OpEqual:
+		return column + " = ?", []interface{}{p.Value}, nil
+	case dsl.OpNotEqual:
+		return column + " != ?", []interface{}{p.Value}, nil
+	case dsl.OpGreater:
+		return column + " > ?", []interface{}{p.Value}, nil
+	case dsl.OpLess:
+		return column + " < ?", []interface{}{p.Value}, nil
+	case dsl.OpIn:
+		values, ok := p.Value.([]interface{})
+		if !ok || len(values) == 0 {
+			return "", nil, fmt.Errorf("field %q: \"in\" requires a non-empty list value", p.Field)
+		}
+		return column + " IN (" + "?" + strings.Repeat(",?", len(values)-1) + ")", values, nil
+	case dsl.OpRegex:
+		return "match(" + column + ", ?)", []interface{}{p.Value}, nil
+	case dsl.OpExists:
+		// service/operation are the only fixed, non-tag columns that are
+		// strings; durationUs (UInt64) and timestamp (DateTime64) can't be
+		// compared against '' without a ClickHouse type error, and both are
+		// mandatory columns anyway, so "exists" on them is meaningless.
+		if column != "service" && column != "operation" {
+			return "", nil, fmt.Errorf("field %q: \"exists\" is not supported on this field", p.Field)
+		}
+		return column + " != ''", nil, nil
+	default:
+		return "", nil, fmt.Errorf("field %q: unsupported operator %q", p.Field, p.Operator)
+	}
+}
+
+// dslOperatorToAttribute translates a dsl.Operator into the AttributeOperator
+// used by the typed tag Map columns, preserving strictness: dsl.OpGreater/
+// dsl.OpLess map to the strict AttributeOperator variants so `gt`/`lt` agree
+// with the `>`/`<` used for non-tag columns instead of silently becoming
+// `>=`/`<=`.
+func dslOperatorToAttribute(op dsl.Operator) (AttributeOperator, error) {
+	switch op {
+	case dsl.OpEqual:
+		return OpEqual, nil
+	case dsl.OpNotEqual:
+		return OpNotEqual, nil
+	case dsl.OpGreater:
+		return OpGreaterThan, nil
+	case dsl.OpLess:
+		return OpLessThan, nil
+	case dsl.OpRegex:
+		return OpRegex, nil
+	case dsl.OpIn:
+		return OpIn, nil
+	case dsl.OpExists:
+		return OpExists, nil
+	default:
+		return "", fmt.Errorf("unsupported operator %q for tag field", op)
+	}
+}
+
+// compileExpr renders a dsl.Expr tree into a parenthesized SQL fragment.
+func compileExpr(e *dsl.Expr) (string, []interface{}, error) {
+	switch {
+	case e.Predicate != nil:
+		return compilePredicate(e.Predicate)
+	case len(e.And) > 0:
+		return compileJoin(e.And, " AND ")
+	case len(e.Or) > 0:
+		return compileJoin(e.Or, " OR ")
+	case e.Not != nil:
+		fragment, args, err := compileExpr(e.Not)
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT (" + fragment + ")", args, nil
+	default:
+		return "", nil, fmt.Errorf("empty query expression")
+	}
+}
+
+func compileJoin(exprs []*dsl.Expr, sep string) (string, []interface{}, error) {
+	fragments := make([]string, 0, len(exprs))
+	args := []interface{}{}
+
+	for _, expr := range exprs {
+		fragment, fragmentArgs, err := compileExpr(expr)
+		if err != nil {
+			return "", nil, err
+		}
+		fragments = append(fragments, "("+fragment+")")
+		args = append(args, fragmentArgs...)
+	}
+
+	return strings.Join(fragments, sep), args, nil
+}
+
+// CompileQuery compiles a dsl.Query into the parameterized ClickHouse SQL
+// statement run against indexTable, along with its bound arguments.
+func (r *TraceReader) CompileQuery(query dsl.Query) (string, []interface{}, error) {
+	sql := fmt.Sprintf("SELECT DISTINCT traceID FROM %s WHERE service = ?", r.indexTable)
+	args := []interface{}{query.Service}
+
+	if query.Operation != "" {
+		sql = sql + " AND operation = ?"
+		args = append(args, query.Operation)
+	}
+
+	if !query.StartTimeMin.IsZero() {
+		sql = sql + " AND timestamp >= toDateTime64(?, 6, 'UTC')"
+		args = append(args, query.StartTimeMin.UTC().Format("2006-01-02T15:04:05"))
+	}
+
+	if !query.StartTimeMax.IsZero() {
+		sql = sql + " AND timestamp <= toDateTime64(?, 6, 'UTC')"
+		args = append(args, query.StartTimeMax.UTC().Format("2006-01-02T15:04:05"))
+	}
+
+	if query.DurationMin != 0 {
+		sql = sql + " AND durationUs >= ?"
+		args = append(args, query.DurationMin.Microseconds())
+	}
+
+	if query.DurationMax != 0 {
+		sql = sql + " AND durationUs <= ?"
+		args = append(args, query.DurationMax.Microseconds())
+	}
+
+	if query.Where != nil {
+		fragment, whereArgs, err := compileExpr(query.Where)
+		if err != nil {
+			return "", nil, err
+		}
+		sql = sql + " AND (" + fragment + ")"
+		args = append(args, whereArgs...)
+	}
+
+	// Cursor resumes a keyset scan after the last (startTime, traceID) row the
+	// client saw. It only composes with the default "ORDER BY ... timestamp
+	// DESC" below, since that's the order the comparison is written against.
+	if query.Cursor != "" {
+		if len(query.Sort) > 0 {
+			return "", nil, fmt.Errorf("cursor pagination is not supported together with a custom sort")
+		}
+
+		lastStartTime, lastTraceID, err := dsl.DecodeCursor(query.Cursor)
+		if err != nil {
+			return "", nil, err
+		}
+
+		sql = sql + " AND (timestamp, traceID) < (toDateTime64(?, 9, 'UTC'), ?)"
+		args = append(args, lastStartTime.UTC().Format("2006-01-02T15:04:05.999999999"), lastTraceID)
+	}
+
+	if len(query.Sort) > 0 {
+		terms := make([]string, len(query.Sort))
+		for i, sort := range query.Sort {
+			column, _, isTag, _, err := dslFieldColumn(sort.Field)
+			if err != nil {
+				return "", nil, err
+			}
+			if isTag {
+				return "", nil, fmt.Errorf("sort field %q: sorting by tag fields is not supported", sort.Field)
+			}
+			direction := "ASC"
+			if sort.Desc {
+				direction = "DESC"
+			}
+			terms[i] = column + " " + direction
+		}
+		sql = sql + " ORDER BY " + strings.Join(terms, ", ")
+	} else {
+		// Sorting by service is required for early termination of primary key scan:
+		// * https://github.com/ClickHouse/ClickHouse/issues/7102
+		// traceID breaks ties on timestamp so the order matches the keyset
+		// cursor's (timestamp, traceID) comparison above; without it, rows
+		// sharing a timestamp have undefined relative order and paging can
+		// skip or repeat traces across requests.
+		sql = sql + " ORDER BY service DESC, timestamp DESC, traceID DESC"
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = dsl.DefaultLimit
+	}
+	sql = sql + " LIMIT ?"
+	args = append(args, limit)
+
+	return sql, args, nil
+}
+
+// InvalidQueryError wraps a CompileQuery failure so callers (e.g. the
+// queryapi HTTP handler) can tell a malformed request apart from a backend
+// failure and respond accordingly, instead of treating every error the same.
+type InvalidQueryError struct {
+	err error
+}
+
+func (e *InvalidQueryError) Error() string { return e.err.Error() }
+func (e *InvalidQueryError) Unwrap() error { return e.err }
+
+// FindTracesByQuery resolves a dsl.Query to trace IDs and returns the
+// matching traces, the same way FindTraces does for TraceQueryParameters.
+func (r *TraceReader) FindTracesByQuery(ctx context.Context, query dsl.Query) ([]*model.Trace, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "FindTracesByQuery")
+	defer span.Finish()
+
+	if r.indexTable == "" {
+		return nil, ErrNoIndexTable
+	}
+
+	sql, args, err := r.CompileQuery(query)
+	if err != nil {
+		return nil, &InvalidQueryError{err: err}
+	}
+
+	span.SetTag("db.statement", sql)
+	span.SetTag("db.args", args)
+
+	traceIDs, err := r.queryTraceIDs(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.getTraces(ctx, traceIDs)
+}
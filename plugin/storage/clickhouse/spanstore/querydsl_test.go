@@ -0,0 +1,111 @@
+package spanstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jaegertracing/jaeger/plugin/storage/clickhouse/spanstore/queryapi/dsl"
+)
+
+func TestDslFieldColumn_RejectsUnknownField(t *testing.T) {
+	_, _, _, _, err := dslFieldColumn("1) UNION SELECT password FROM users--")
+	require.Error(t, err)
+}
+
+func TestDslFieldColumn_KnownFields(t *testing.T) {
+	column, key, isTag, resource, err := dslFieldColumn("tags.http.status_code")
+	require.NoError(t, err)
+	assert.Equal(t, "tags", column)
+	assert.Equal(t, "http.status_code", key)
+	assert.True(t, isTag)
+	assert.False(t, resource)
+
+	column, key, isTag, resource, err = dslFieldColumn("process.tags.k8s.pod")
+	require.NoError(t, err)
+	assert.Equal(t, "resource", column)
+	assert.Equal(t, "k8s.pod", key)
+	assert.True(t, isTag)
+	assert.True(t, resource)
+
+	column, _, isTag, _, err = dslFieldColumn(dsl.FieldDuration)
+	require.NoError(t, err)
+	assert.Equal(t, "durationUs", column)
+	assert.False(t, isTag)
+}
+
+func TestDslOperatorToAttribute_GreaterLessAreStrict(t *testing.T) {
+	op, err := dslOperatorToAttribute(dsl.OpGreater)
+	require.NoError(t, err)
+	assert.Equal(t, OpGreaterThan, op)
+
+	op, err = dslOperatorToAttribute(dsl.OpLess)
+	require.NoError(t, err)
+	assert.Equal(t, OpLessThan, op)
+}
+
+func TestCompilePredicate_NonTagField(t *testing.T) {
+	sql, args, err := compilePredicate(&dsl.Predicate{Field: dsl.FieldDuration, Operator: dsl.OpGreater, Value: 1000})
+	require.NoError(t, err)
+	assert.Equal(t, "durationUs > ?", sql)
+	assert.Equal(t, []interface{}{1000}, args)
+}
+
+func TestCompilePredicate_TagFieldUsesAttributeOperator(t *testing.T) {
+	sql, args, err := compilePredicate(&dsl.Predicate{Field: "tags.http.status_code", Operator: dsl.OpGreater, Value: int64(500)})
+	require.NoError(t, err)
+	assert.Contains(t, sql, "> ?")
+	assert.NotContains(t, sql, ">= ?")
+	assert.Equal(t, []interface{}{"http.status_code", "http.status_code", int64(500)}, args)
+}
+
+func TestCompilePredicate_UnknownFieldIsRejected(t *testing.T) {
+	_, _, err := compilePredicate(&dsl.Predicate{Field: "bogus) OR 1=1 --", Operator: dsl.OpEqual, Value: "x"})
+	assert.Error(t, err)
+}
+
+func TestCompileExpr_BooleanComposition(t *testing.T) {
+	expr := &dsl.Expr{
+		And: []*dsl.Expr{
+			{Predicate: &dsl.Predicate{Field: dsl.FieldOperation, Operator: dsl.OpEqual, Value: "checkout"}},
+			{Not: &dsl.Expr{Predicate: &dsl.Predicate{Field: dsl.FieldService, Operator: dsl.OpEqual, Value: "cart"}}},
+		},
+	}
+
+	sql, args, err := compileExpr(expr)
+	require.NoError(t, err)
+	assert.Equal(t, "(operation = ?) AND (NOT (service = ?))", sql)
+	assert.Equal(t, []interface{}{"checkout", "cart"}, args)
+}
+
+func TestCompileQuery_RejectsCursorWithSort(t *testing.T) {
+	r := NewTraceReader(nil, "operations", "index", "spans", "summary", 0)
+
+	_, _, err := r.CompileQuery(dsl.Query{
+		Service: "svc",
+		Sort:    []dsl.SortField{{Field: dsl.FieldStartTime, Desc: true}},
+		Cursor:  dsl.EncodeCursor(time.Unix(1700000000, 0), "abc"),
+	})
+	assert.Error(t, err)
+}
+
+func TestCompileQuery_CursorAddsKeysetPredicate(t *testing.T) {
+	r := NewTraceReader(nil, "operations", "index", "spans", "summary", 0)
+	cursor := dsl.EncodeCursor(time.Unix(1700000000, 0), "abc123")
+
+	sql, args, err := r.CompileQuery(dsl.Query{Service: "svc", Cursor: cursor})
+	require.NoError(t, err)
+	assert.Contains(t, sql, "(timestamp, traceID) < (toDateTime64(?, 9, 'UTC'), ?)")
+	assert.Contains(t, args, "abc123")
+}
+
+func TestCompileQuery_DefaultLimit(t *testing.T) {
+	r := NewTraceReader(nil, "operations", "index", "spans", "summary", 0)
+
+	sql, args, err := r.CompileQuery(dsl.Query{Service: "svc"})
+	require.NoError(t, err)
+	assert.Contains(t, sql, "LIMIT ?")
+	assert.Equal(t, dsl.DefaultLimit, args[len(args)-1])
+}
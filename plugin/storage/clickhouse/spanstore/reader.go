@@ -2,12 +2,13 @@ package spanstore
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"strings"
+	"sync"
+	"time"
 
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 	"github.com/gogo/protobuf/proto"
 	"github.com/opentracing/opentracing-go"
 
@@ -18,24 +19,120 @@ import (
 var (
 	ErrNoOperationsTable = errors.New("no operations table supplied")
 	ErrNoIndexTable      = errors.New("no index table supplied")
+	ErrNoSummaryTable    = errors.New("no summary table supplied")
 )
 
+// deserializeWorkers bounds how many goroutines unmarshal span payloads
+// concurrently. Serial proto.Unmarshal in the row loop is the hot path for
+// large traces, so getTraces fans this out instead.
+const deserializeWorkers = 8
+
 // SpanWriter for reading spans from ClickHouse
 type TraceReader struct {
-	db              *sql.DB
+	conn            driver.Conn
 	operationsTable string
 	indexTable      string
 	spansTable      string
+	summaryTable    string
+	readTimeout     time.Duration
 }
 
-// NewTraceReader returns a TraceReader for the database
-func NewTraceReader(db *sql.DB, operationsTable, indexTable, spansTable string) *TraceReader {
+// NewTraceReader returns a TraceReader backed by a pooled native ClickHouse
+// connection (see OpenPool). summaryTable is optional and only required by
+// FindTraceIDsWithQuality; pass "" if trace-quality filtering isn't needed.
+// readTimeout bounds every statement the reader issues; a zero value falls
+// back to DefaultPoolConfig().ReadTimeout.
+func NewTraceReader(conn driver.Conn, operationsTable, indexTable, spansTable, summaryTable string, readTimeout time.Duration) *TraceReader {
+	if readTimeout <= 0 {
+		readTimeout = DefaultPoolConfig().ReadTimeout
+	}
+
 	return &TraceReader{
-		db:              db,
+		conn:            conn,
 		operationsTable: operationsTable,
 		indexTable:      indexTable,
 		spansTable:      spansTable,
+		summaryTable:    summaryTable,
+		readTimeout:     readTimeout,
+	}
+}
+
+// timeoutRows wraps driver.Rows so the per-statement timeout context set up
+// by query is canceled once the caller is done reading (Close), instead of
+// immediately after query returns - clickhouse-go/v2 streams rows lazily
+// under that context, so canceling it early fails the first Next().
+type timeoutRows struct {
+	driver.Rows
+	cancel context.CancelFunc
+}
+
+func (r *timeoutRows) Close() error {
+	err := r.Rows.Close()
+	r.cancel()
+	return err
+}
+
+// query runs sql against the pooled connection, bounding it by the reader's
+// configured read timeout for the lifetime of the returned rows.
+func (r *TraceReader) query(ctx context.Context, sql string, args ...interface{}) (driver.Rows, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.readTimeout)
+
+	rows, err := r.conn.Query(ctx, sql, args...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return &timeoutRows{Rows: rows, cancel: cancel}, nil
+}
+
+// deserializeSpans unmarshals raw model payloads (JSON or proto, self
+// describing by leading byte) across a bounded worker pool.
+func deserializeSpans(raw [][]byte) ([]*model.Span, error) {
+	spans := make([]*model.Span, len(raw))
+	errs := make([]error, len(raw))
+
+	workers := deserializeWorkers
+	if workers > len(raw) {
+		workers = len(raw)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				span := &model.Span{}
+
+				var err error
+				if len(raw[i]) > 0 && raw[i][0] == '{' {
+					err = json.Unmarshal(raw[i], span)
+				} else {
+					err = proto.Unmarshal(raw[i], span)
+				}
+
+				spans[i] = span
+				errs[i] = err
+			}
+		}()
+	}
+
+	for i := range raw {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
 	}
+
+	return spans, nil
 }
 
 func (r *TraceReader) getTraces(ctx context.Context, traceIDs []model.TraceID) ([]*model.Trace, error) {
@@ -45,27 +142,27 @@ func (r *TraceReader) getTraces(ctx context.Context, traceIDs []model.TraceID) (
 		return returning, nil
 	}
 
-	span, _ := opentracing.StartSpanFromContext(ctx, "getTraces")
+	span, ctx := opentracing.StartSpanFromContext(ctx, "getTraces")
 	defer span.Finish()
 
-	values := make([]interface{}, len(traceIDs))
+	idValues := make([]string, len(traceIDs))
 	for i, traceID := range traceIDs {
-		values[i] = traceID.String()
+		idValues[i] = traceID.String()
 	}
 
-	query := fmt.Sprintf("SELECT model FROM %s WHERE traceID IN (%s)", r.spansTable, "?"+strings.Repeat(",?", len(values)-1))
+	query := fmt.Sprintf("SELECT model FROM %s WHERE traceID IN ?", r.spansTable)
 
 	span.SetTag("db.statement", query)
-	span.SetTag("db.args", values)
+	span.SetTag("db.args", idValues)
 
-	rows, err := r.db.QueryContext(ctx, query, values...)
+	rows, err := r.query(ctx, query, idValues)
 	if err != nil {
 		return nil, err
 	}
 
 	defer rows.Close()
 
-	traces := map[model.TraceID]*model.Trace{}
+	var raw [][]byte
 
 	for rows.Next() {
 		var serialized string
@@ -74,27 +171,26 @@ func (r *TraceReader) getTraces(ctx context.Context, traceIDs []model.TraceID) (
 			return nil, err
 		}
 
-		span := model.Span{}
+		raw = append(raw, []byte(serialized))
+	}
 
-		if serialized[0] == '{' {
-			err = json.Unmarshal([]byte(serialized), &span)
-		} else {
-			err = proto.Unmarshal([]byte(serialized), &span)
-		}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-		if err != nil {
-			return nil, err
-		}
+	spans, err := deserializeSpans(raw)
+	if err != nil {
+		return nil, err
+	}
 
+	traces := map[model.TraceID]*model.Trace{}
+
+	for _, span := range spans {
 		if _, ok := traces[span.TraceID]; !ok {
 			traces[span.TraceID] = &model.Trace{}
 		}
 
-		traces[span.TraceID].Spans = append(traces[span.TraceID].Spans, &span)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, err
+		traces[span.TraceID].Spans = append(traces[span.TraceID].Spans, span)
 	}
 
 	for _, traceID := range traceIDs {
@@ -124,7 +220,7 @@ func (r *TraceReader) GetTrace(ctx context.Context, traceID model.TraceID) (*mod
 }
 
 func (r *TraceReader) getStrings(ctx context.Context, sql string, args ...interface{}) ([]string, error) {
-	rows, err := r.db.QueryContext(ctx, sql, args...)
+	rows, err := r.query(ctx, sql, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -164,7 +260,10 @@ func (r *TraceReader) GetServices(ctx context.Context) ([]string, error) {
 	return r.getStrings(ctx, query)
 }
 
-// GetOperations fetches operations in the service and empty slice if service does not exists
+// GetOperations fetches operations in the service and empty slice if service does not exists.
+// When params.SpanKind is set it restricts the results to operations recorded with that kind.
+// SpanKind is only tracked on indexTable (operationsTable holds just the
+// distinct service/operation pairs), so the filtered form reads from there.
 func (r *TraceReader) GetOperations(
 	ctx context.Context,
 	params spanstore.OperationQueryParameters,
@@ -172,12 +271,52 @@ func (r *TraceReader) GetOperations(
 	span, ctx := opentracing.StartSpanFromContext(ctx, "GetOperations")
 	defer span.Finish()
 
-	if r.operationsTable == "" {
-		return nil, ErrNoOperationsTable
+	var query string
+	args := []interface{}{params.ServiceName}
+
+	if params.SpanKind != "" {
+		if r.indexTable == "" {
+			return nil, ErrNoIndexTable
+		}
+		query = fmt.Sprintf("SELECT operation FROM %s WHERE service = ? AND spanKind = ? GROUP BY operation", r.indexTable)
+		args = append(args, params.SpanKind)
+	} else {
+		if r.operationsTable == "" {
+			return nil, ErrNoOperationsTable
+		}
+		query = fmt.Sprintf("SELECT operation FROM %s WHERE service = ? GROUP BY operation", r.operationsTable)
 	}
 
-	query := fmt.Sprintf("SELECT operation FROM %s WHERE service = ? GROUP BY operation", r.operationsTable)
-	args := []interface{}{params.ServiceName}
+	span.SetTag("db.statement", query)
+	span.SetTag("db.args", args)
+
+	names, err := r.getStrings(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	operations := make([]spanstore.Operation, len(names))
+	for i, name := range names {
+		operations[i].Name = name
+	}
+
+	return operations, nil
+}
+
+// GetRootOperations fetches the operations that appear as trace roots for
+// service, i.e. spans with no parent reference. is_root is only tracked on
+// indexTable (operationsTable holds just the distinct service/operation
+// pairs), so this reads from there instead.
+func (r *TraceReader) GetRootOperations(ctx context.Context, service string) ([]spanstore.Operation, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "GetRootOperations")
+	defer span.Finish()
+
+	if r.indexTable == "" {
+		return nil, ErrNoIndexTable
+	}
+
+	query := fmt.Sprintf("SELECT DISTINCT operation FROM %s WHERE service = ? AND is_root = 1", r.indexTable)
+	args := []interface{}{service}
 
 	span.SetTag("db.statement", query)
 	span.SetTag("db.args", args)
@@ -208,15 +347,15 @@ func (r *TraceReader) FindTraces(ctx context.Context, query *spanstore.TraceQuer
 	return r.getTraces(ctx, traceIDs)
 }
 
-// FindTraceIDs retrieves only the TraceIDs that match the traceQuery, but not the trace data
-func (r *TraceReader) FindTraceIDs(ctx context.Context, params *spanstore.TraceQueryParameters) ([]model.TraceID, error) {
-	span, ctx := opentracing.StartSpanFromContext(ctx, "FindTraceIDs")
-	defer span.Finish()
-
-	if r.indexTable == "" {
-		return nil, ErrNoIndexTable
-	}
-
+// buildTraceIDsQuery renders the base SELECT DISTINCT traceID query shared by
+// FindTraceIDs, FindTraceIDsWithAttributes, FindTraceIDsWithQuality and
+// ExplainFindTraces from the plain TraceQueryParameters filters (service,
+// operation, time range, duration range and equality tags). Equality tags
+// go through AttributePredicate rather than the legacy `tags` array, so a
+// single query never mixes the two schemas. params.Tags values are strings,
+// so they are matched against tags_string only; a tag the writer stored in
+// tags_int64, tags_float64 or tags_bool is not matched by them.
+func (r *TraceReader) buildTraceIDsQuery(params *spanstore.TraceQueryParameters) (string, []interface{}, error) {
 	query := fmt.Sprintf("SELECT DISTINCT traceID FROM %s WHERE service = ?", r.indexTable)
 	args := []interface{}{params.ServiceName}
 
@@ -246,8 +385,68 @@ func (r *TraceReader) FindTraceIDs(ctx context.Context, params *spanstore.TraceQ
 	}
 
 	for key, value := range params.Tags {
-		query = query + " AND has(tags, ?)"
-		args = append(args, fmt.Sprintf("%s=%s", key, value))
+		fragment, predicateArgs, err := buildAttributePredicate(AttributePredicate{Scope: ScopeSpanTag, Key: key, Operator: OpEqual, Value: value})
+		if err != nil {
+			return "", nil, err
+		}
+		query = query + " AND " + fragment
+		args = append(args, predicateArgs...)
+	}
+
+	return query, args, nil
+}
+
+// FindTraceIDs retrieves only the TraceIDs that match the traceQuery, but not the trace data
+func (r *TraceReader) FindTraceIDs(ctx context.Context, params *spanstore.TraceQueryParameters) ([]model.TraceID, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "FindTraceIDs")
+	defer span.Finish()
+
+	if r.indexTable == "" {
+		return nil, ErrNoIndexTable
+	}
+
+	query, args, err := r.buildTraceIDsQuery(params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sorting by service is required for early termination of primary key scan:
+	// * https://github.com/ClickHouse/ClickHouse/issues/7102
+	query = query + " ORDER BY service DESC, timestamp DESC LIMIT ?"
+	args = append(args, params.NumTraces)
+
+	span.SetTag("db.statement", query)
+	span.SetTag("db.args", args)
+
+	return r.queryTraceIDs(ctx, query, args...)
+}
+
+// FindTraceIDsWithAttributes retrieves TraceIDs matching both the plain
+// TraceQueryParameters filters and a set of typed span/resource attribute
+// predicates (numeric comparisons, contains, regex) that the equality-only
+// params.Tags map cannot express. It requires the indexTable to carry the
+// tags_string/tags_int64/tags_float64/tags_bool and resource_* Map columns
+// described in attributes.go.
+func (r *TraceReader) FindTraceIDsWithAttributes(ctx context.Context, params *spanstore.TraceQueryParameters, attrs *AttributeQuery) ([]model.TraceID, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "FindTraceIDsWithAttributes")
+	defer span.Finish()
+
+	if r.indexTable == "" {
+		return nil, ErrNoIndexTable
+	}
+
+	query, args, err := r.buildTraceIDsQuery(params)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, predicate := range attrs.Predicates {
+		fragment, predicateArgs, err := buildAttributePredicate(predicate)
+		if err != nil {
+			return nil, err
+		}
+		query = query + " AND " + fragment
+		args = append(args, predicateArgs...)
 	}
 
 	// Sorting by service is required for early termination of primary key scan:
@@ -258,6 +457,11 @@ func (r *TraceReader) FindTraceIDs(ctx context.Context, params *spanstore.TraceQ
 	span.SetTag("db.statement", query)
 	span.SetTag("db.args", args)
 
+	return r.queryTraceIDs(ctx, query, args...)
+}
+
+// queryTraceIDs runs a SELECT DISTINCT traceID query and parses the results.
+func (r *TraceReader) queryTraceIDs(ctx context.Context, query string, args ...interface{}) ([]model.TraceID, error) {
 	traceIDStrings, err := r.getStrings(ctx, query, args...)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,62 @@
+package spanstore
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jaegertracing/jaeger/model"
+)
+
+func TestDeserializeSpans_Proto(t *testing.T) {
+	span := &model.Span{OperationName: "checkout"}
+	serialized, err := proto.Marshal(span)
+	require.NoError(t, err)
+
+	spans, err := deserializeSpans([][]byte{serialized})
+	require.NoError(t, err)
+	require.Len(t, spans, 1)
+	assert.Equal(t, "checkout", spans[0].OperationName)
+}
+
+func TestDeserializeSpans_JSON(t *testing.T) {
+	span := &model.Span{OperationName: "checkout"}
+	serialized, err := json.Marshal(span)
+	require.NoError(t, err)
+
+	spans, err := deserializeSpans([][]byte{serialized})
+	require.NoError(t, err)
+	require.Len(t, spans, 1)
+	assert.Equal(t, "checkout", spans[0].OperationName)
+}
+
+func TestDeserializeSpans_PreservesOrderAcrossWorkers(t *testing.T) {
+	raw := make([][]byte, 0, deserializeWorkers*3)
+	for i := 0; i < cap(raw); i++ {
+		serialized, err := proto.Marshal(&model.Span{OperationName: opName(i)})
+		require.NoError(t, err)
+		raw = append(raw, serialized)
+	}
+
+	spans, err := deserializeSpans(raw)
+	require.NoError(t, err)
+	require.Len(t, spans, len(raw))
+	for i, span := range spans {
+		assert.Equal(t, opName(i), span.OperationName)
+	}
+}
+
+func TestDeserializeSpans_PropagatesUnmarshalError(t *testing.T) {
+	// An unterminated varint: every byte has its continuation bit set, so
+	// proto.Unmarshal runs off the end of the buffer instead of parsing cleanly.
+	malformed := []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+	_, err := deserializeSpans([][]byte{malformed})
+	assert.Error(t, err)
+}
+
+func opName(i int) string {
+	return "op-" + string(rune('a'+i%26))
+}
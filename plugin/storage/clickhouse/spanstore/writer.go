@@ -0,0 +1,143 @@
+package spanstore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/gogo/protobuf/proto"
+
+	"github.com/jaegertracing/jaeger/model"
+)
+
+// TraceWriter persists spans into the tables TraceReader reads (see
+// schema.sql): spansTable for the raw payload, indexTable for the typed
+// tags_*/resource_* Map columns plus is_root/spanKind, operationsTable for
+// the distinct service/operation pairs, and summaryTable (one row per span)
+// backing FindTraceIDsWithQuality.
+type TraceWriter struct {
+	conn            driver.Conn
+	operationsTable string
+	indexTable      string
+	spansTable      string
+	summaryTable    string
+}
+
+// NewTraceWriter returns a TraceWriter for the given tables. summaryTable is
+// optional, matching NewTraceReader; pass "" to skip trace-quality indexing.
+func NewTraceWriter(conn driver.Conn, operationsTable, indexTable, spansTable, summaryTable string) *TraceWriter {
+	return &TraceWriter{
+		conn:            conn,
+		operationsTable: operationsTable,
+		indexTable:      indexTable,
+		spansTable:      spansTable,
+		summaryTable:    summaryTable,
+	}
+}
+
+// WriteSpan persists span across spansTable, indexTable, operationsTable and,
+// if configured, summaryTable.
+func (w *TraceWriter) WriteSpan(ctx context.Context, span *model.Span) error {
+	serialized, err := proto.Marshal(span)
+	if err != nil {
+		return err
+	}
+
+	if err := w.conn.Exec(ctx, fmt.Sprintf("INSERT INTO %s (traceID, model) VALUES (?, ?)", w.spansTable),
+		span.TraceID.String(), string(serialized)); err != nil {
+		return err
+	}
+
+	service := serviceName(span)
+	tagsString, tagsInt64, tagsFloat64, tagsBool := splitTags(span.Tags)
+	resourceString, resourceInt64, resourceFloat64, resourceBool := map[string]string{}, map[string]int64{}, map[string]float64{}, map[string]bool{}
+	if span.Process != nil {
+		resourceString, resourceInt64, resourceFloat64, resourceBool = splitTags(span.Process.Tags)
+	}
+
+	indexQuery := fmt.Sprintf(`INSERT INTO %s (
+		traceID, service, operation, spanKind, is_root, timestamp, durationUs,
+		tags_string, tags_int64, tags_float64, tags_bool,
+		resource_string, resource_int64, resource_float64, resource_bool
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, w.indexTable)
+
+	if err := w.conn.Exec(ctx, indexQuery,
+		span.TraceID.String(), service, span.OperationName, spanKindTag(span.Tags), boolToUint8(isRootSpan(span)),
+		span.StartTime, span.Duration.Microseconds(),
+		tagsString, tagsInt64, tagsFloat64, tagsBool,
+		resourceString, resourceInt64, resourceFloat64, resourceBool,
+	); err != nil {
+		return err
+	}
+
+	if err := w.conn.Exec(ctx, fmt.Sprintf("INSERT INTO %s (service, operation) VALUES (?, ?)", w.operationsTable),
+		service, span.OperationName); err != nil {
+		return err
+	}
+
+	if w.summaryTable == "" {
+		return nil
+	}
+
+	return w.conn.Exec(ctx, fmt.Sprintf("INSERT INTO %s (traceID, service, operation, hasError, durationUs) VALUES (?, ?, ?, ?, ?)", w.summaryTable),
+		span.TraceID.String(), service, span.OperationName, boolToUint8(hasErrorTag(span.Tags)), span.Duration.Microseconds())
+}
+
+func serviceName(span *model.Span) string {
+	if span.Process == nil {
+		return ""
+	}
+	return span.Process.ServiceName
+}
+
+// isRootSpan reports whether span has no parent reference, i.e. it is the
+// entry point of its trace.
+func isRootSpan(span *model.Span) bool {
+	return len(span.References) == 0
+}
+
+func spanKindTag(tags []model.KeyValue) string {
+	for _, tag := range tags {
+		if tag.Key == "span.kind" {
+			return tag.VStr
+		}
+	}
+	return ""
+}
+
+func hasErrorTag(tags []model.KeyValue) bool {
+	for _, tag := range tags {
+		if tag.Key == "error" && tag.VType == model.BoolType && tag.VBool {
+			return true
+		}
+	}
+	return false
+}
+
+// splitTags buckets tags by value type into the Map columns attributeColumn
+// (attributes.go) expects: tags_string, tags_int64, tags_float64, tags_bool.
+func splitTags(tags []model.KeyValue) (strs map[string]string, int64s map[string]int64, float64s map[string]float64, bools map[string]bool) {
+	strs, int64s, float64s, bools = map[string]string{}, map[string]int64{}, map[string]float64{}, map[string]bool{}
+
+	for _, tag := range tags {
+		switch tag.VType {
+		case model.StringType:
+			strs[tag.Key] = tag.VStr
+		case model.Int64Type:
+			int64s[tag.Key] = tag.VInt64
+		case model.Float64Type:
+			float64s[tag.Key] = tag.VFloat64
+		case model.BoolType:
+			bools[tag.Key] = tag.VBool
+		}
+	}
+
+	return strs, int64s, float64s, bools
+}
+
+func boolToUint8(b bool) uint8 {
+	if b {
+		return 1
+	}
+	return 0
+}